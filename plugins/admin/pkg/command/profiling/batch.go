@@ -0,0 +1,224 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EventType identifies what a ProgressEvent reports on.
+type EventType int
+
+const (
+	// EventPodStarted fires when a pod's download begins.
+	EventPodStarted EventType = iota
+	// EventPodDone fires when a pod's download finishes, successfully or not.
+	EventPodDone
+)
+
+// ProgressEvent reports the fate of a single pod's download as part of a
+// BatchDownloader run, so callers can render progress as the fleet-wide
+// snapshot comes in rather than waiting for every pod to finish.
+type ProgressEvent struct {
+	Type EventType
+	Pod  string
+	Err  error
+}
+
+// BatchOptions configures a BatchDownloader.Download call.
+type BatchOptions struct {
+	// Namespace is the namespace the matching pods live in.
+	Namespace string
+
+	// LabelSelector restricts the pods that are downloaded from. It is
+	// mutually exclusive with PodNames; if both are set, PodNames wins.
+	LabelSelector string
+
+	// PodNames restricts the download to this explicit set of pods,
+	// bypassing LabelSelector.
+	PodNames []string
+
+	// ProfileType is the pprof profile downloaded from every matching pod.
+	ProfileType ProfileType
+
+	// Concurrency caps how many pods are downloaded from at once. A value
+	// <= 0 means unbounded.
+	Concurrency int
+
+	// PerPodTimeout bounds how long a single pod's download may take
+	// before it is treated as failed.
+	PerPodTimeout time.Duration
+
+	// Events, if non-nil, receives a ProgressEvent for every pod as its
+	// download starts and finishes. BatchDownloader closes it once every
+	// pod has been processed.
+	//
+	// Events must be drained concurrently with the Download call, e.g. by
+	// ranging over it from another goroutine started before Download. Each
+	// send happens while its worker still holds a Concurrency semaphore
+	// slot, so a caller that only reads Events after Download returns will
+	// deadlock as soon as the buffer fills.
+	Events chan<- ProgressEvent
+}
+
+// PodWriter returns the destination for a single pod's profile, named
+// using the `podname-profiletype-timestamp.pb.gz` convention used
+// throughout the fleet snapshot.
+type PodWriter func(podName string, pt ProfileType, timestamp time.Time) (io.WriteCloser, error)
+
+// PortForwarder opens a port-forward to pod in namespace and returns a
+// ready Downloader pointed at it. Callers typically implement this with
+// client-go's portforward.New, matching how the single-pod profiling
+// command already connects to a pod.
+type PortForwarder func(ctx context.Context, namespace, pod string) (*Downloader, error)
+
+// BatchDownloader downloads a pprof profile from every pod matched by a
+// label selector (or an explicit pod list) concurrently, writing each
+// pod's profile out via a caller-supplied PodWriter.
+type BatchDownloader struct {
+	Client    kubernetes.Interface
+	Forward   PortForwarder
+	NewWriter PodWriter
+}
+
+// NewBatchDownloader creates a BatchDownloader that lists pods via client
+// and opens port-forwards via forward, writing results with newWriter.
+func NewBatchDownloader(client kubernetes.Interface, forward PortForwarder, newWriter PodWriter) *BatchDownloader {
+	return &BatchDownloader{Client: client, Forward: forward, NewWriter: newWriter}
+}
+
+// Download fans out a download of opts.ProfileType to every pod selected
+// by opts.PodNames or opts.LabelSelector, bounding concurrency at
+// opts.Concurrency. It returns a *multierror.Error aggregating every
+// per-pod failure; a nil return means every pod succeeded.
+func (b *BatchDownloader) Download(ctx context.Context, opts BatchOptions) error {
+	if opts.Events != nil {
+		defer close(opts.Events)
+	}
+
+	pods, err := b.resolvePods(opts)
+	if err != nil {
+		return fmt.Errorf("failed to resolve pods: %v", err)
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("no pods matched namespace %q", opts.Namespace)
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(pods)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   *multierror.Error
+		result error
+	)
+	wg.Add(len(pods))
+	for _, pod := range pods {
+		pod := pod
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if opts.Events != nil {
+				opts.Events <- ProgressEvent{Type: EventPodStarted, Pod: pod}
+			}
+			err := b.downloadOne(ctx, pod, opts)
+			if opts.Events != nil {
+				opts.Events <- ProgressEvent{Type: EventPodDone, Pod: pod, Err: err}
+			}
+			if err != nil {
+				mu.Lock()
+				errs = multierror.Append(errs, fmt.Errorf("pod %q: %v", pod, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if errs != nil {
+		result = errs.ErrorOrNil()
+	}
+	return result
+}
+
+func (b *BatchDownloader) downloadOne(ctx context.Context, pod string, opts BatchOptions) error {
+	podCtx := ctx
+	if opts.PerPodTimeout > 0 {
+		var cancel context.CancelFunc
+		podCtx, cancel = context.WithTimeout(ctx, opts.PerPodTimeout)
+		defer cancel()
+	}
+
+	d, err := b.Forward(podCtx, opts.Namespace, pod)
+	if err != nil {
+		return fmt.Errorf("port-forward failed: %v", err)
+	}
+	defer close(d.stopCh)
+
+	timestamp := timeNow()
+	w, err := b.NewWriter(pod, opts.ProfileType, timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to open output: %v", err)
+	}
+	defer w.Close()
+
+	// Use captureOne rather than Download so PerPodTimeout actually bounds
+	// the HTTP read, not just the port-forward setup: Download takes no
+	// context and would otherwise let a hung pod hold its semaphore slot
+	// forever.
+	data, err := d.captureOne(podCtx, opts.ProfileType, 0)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (b *BatchDownloader) resolvePods(opts BatchOptions) ([]string, error) {
+	if len(opts.PodNames) > 0 {
+		return opts.PodNames, nil
+	}
+
+	list, err := b.Client.CoreV1().Pods(opts.Namespace).List(metav1.ListOptions{
+		LabelSelector: opts.LabelSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, pod := range list.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			names = append(names, pod.Name)
+		}
+	}
+	return names, nil
+}
+
+// timeNow is a var so tests can stub out the clock.
+var timeNow = time.Now
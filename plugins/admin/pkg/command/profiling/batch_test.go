@@ -0,0 +1,137 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestBatchDownload(t *testing.T) {
+	newPodForwarder := func(t *testing.T, fail map[string]bool) PortForwarder {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("sample"))
+		}))
+		t.Cleanup(server.Close)
+		_, portString, err := net.SplitHostPort(server.Listener.Addr().String())
+		assert.NilError(t, err)
+		port, err := strconv.ParseInt(portString, 10, 0)
+		assert.NilError(t, err)
+
+		return func(ctx context.Context, namespace, pod string) (*Downloader, error) {
+			if fail[pod] {
+				return nil, fmt.Errorf("simulated port-forward failure for %s", pod)
+			}
+			d := &Downloader{
+				readyCh:   make(chan struct{}),
+				stopCh:    make(chan struct{}),
+				client:    http.DefaultClient,
+				localPort: uint32(port),
+			}
+			close(d.readyCh)
+			return d, nil
+		}
+	}
+
+	t.Run("downloads from every pod matching the label selector", func(t *testing.T) {
+		client := fake.NewSimpleClientset(
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "svc-0", Namespace: "ns", Labels: map[string]string{"app": "svc"}}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "svc-1", Namespace: "ns", Labels: map[string]string{"app": "svc"}}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-0", Namespace: "ns", Labels: map[string]string{"app": "other"}}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		)
+
+		var mu sync.Mutex
+		buffers := map[string]*bytes.Buffer{}
+		writer := func(podName string, pt ProfileType, ts time.Time) (io.WriteCloser, error) {
+			mu.Lock()
+			buf := &bytes.Buffer{}
+			buffers[podName] = buf
+			mu.Unlock()
+			return nopCloser{buf}, nil
+		}
+
+		b := NewBatchDownloader(client, newPodForwarder(t, nil), writer)
+		events := make(chan ProgressEvent, 10)
+		err := b.Download(context.Background(), BatchOptions{
+			Namespace:     "ns",
+			LabelSelector: "app=svc",
+			ProfileType:   ProfileTypeHeap,
+			Concurrency:   2,
+			Events:        events,
+		})
+		assert.NilError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 2, len(buffers))
+		assert.Equal(t, "sample", buffers["svc-0"].String())
+		assert.Equal(t, "sample", buffers["svc-1"].String())
+
+		var done int
+		for e := range events {
+			if e.Type == EventPodDone {
+				done++
+			}
+		}
+		assert.Equal(t, 2, done)
+	})
+
+	t.Run("aggregates per-pod failures into a multierror", func(t *testing.T) {
+		client := fake.NewSimpleClientset(
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "svc-0", Namespace: "ns", Labels: map[string]string{"app": "svc"}}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+			&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "svc-1", Namespace: "ns", Labels: map[string]string{"app": "svc"}}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		)
+		writer := func(podName string, pt ProfileType, ts time.Time) (io.WriteCloser, error) {
+			return nopCloser{&bytes.Buffer{}}, nil
+		}
+
+		b := NewBatchDownloader(client, newPodForwarder(t, map[string]bool{"svc-1": true}), writer)
+		err := b.Download(context.Background(), BatchOptions{
+			Namespace:     "ns",
+			LabelSelector: "app=svc",
+			ProfileType:   ProfileTypeHeap,
+		})
+		assert.ErrorContains(t, err, "svc-1")
+	})
+
+	t.Run("no pods matched", func(t *testing.T) {
+		client := fake.NewSimpleClientset()
+		writer := func(podName string, pt ProfileType, ts time.Time) (io.WriteCloser, error) {
+			return nopCloser{&bytes.Buffer{}}, nil
+		}
+		b := NewBatchDownloader(client, newPodForwarder(t, nil), writer)
+		err := b.Download(context.Background(), BatchOptions{Namespace: "ns", LabelSelector: "app=missing"})
+		assert.ErrorContains(t, err, "no pods matched")
+	})
+}
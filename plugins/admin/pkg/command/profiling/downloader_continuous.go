@@ -0,0 +1,363 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputFormat selects how DownloadContinuous serializes the samples it
+// captures.
+type OutputFormat int
+
+const (
+	// OutputFormatRaw concatenates every sample as a raw pprof profile.
+	// Only valid for a single profile type unless a RotationPolicy is set.
+	OutputFormatRaw OutputFormat = iota
+	// OutputFormatGzip gzips every sample before writing it out. Only
+	// valid for a single profile type unless a RotationPolicy is set.
+	OutputFormatGzip
+	// OutputFormatTar bundles every sample into a tar archive, one entry
+	// per sample, named "<profiletype>-<seq>.pb.gz".
+	OutputFormatTar
+)
+
+// timedEndpoints are the pprof endpoint paths that accept the `seconds`
+// query parameter instead of returning a point-in-time snapshot.
+var timedEndpoints = map[string]bool{
+	"/debug/pprof/profile": true, // cpu profile
+	"/debug/pprof/trace":   true,
+}
+
+// isTimedProfile reports whether pt is captured over a duration (CPU,
+// trace) rather than as a point-in-time snapshot (heap, goroutine).
+func isTimedProfile(pt ProfileType) bool {
+	return timedEndpoints[ProfileEndpoints[pt]]
+}
+
+// profileTypeName derives a short, filesystem-safe name for pt from its
+// pprof endpoint, e.g. "/debug/pprof/heap" -> "heap".
+func profileTypeName(pt ProfileType) string {
+	endpoint := ProfileEndpoints[pt]
+	if i := strings.LastIndex(endpoint, "/"); i >= 0 {
+		return endpoint[i+1:]
+	}
+	return endpoint
+}
+
+// RotationPolicy writes each sample to its own file under Dir instead of
+// appending it to a single io.Writer, so a long collection window doesn't
+// produce one unbounded file.
+type RotationPolicy struct {
+	// Dir is the directory samples are written into. It must already exist.
+	Dir string
+
+	// MaxFiles caps the number of rotated files kept on disk, oldest first;
+	// zero means unbounded.
+	MaxFiles int
+}
+
+// ContinuousOptions configures a DownloadContinuous call.
+type ContinuousOptions struct {
+	// SampleDuration is the `seconds` query parameter sent for profile
+	// types that support timed sampling (CPU, trace). It is ignored for
+	// point-in-time profile types such as heap or goroutine, and must be
+	// either zero or at least one second for timed ones, since pprof's
+	// `seconds` parameter is a whole number.
+	SampleDuration time.Duration
+
+	// Interval is how often a new round of samples is captured. It must be
+	// greater than or equal to SampleDuration, since a timed sample already
+	// occupies the pod for SampleDuration.
+	Interval time.Duration
+
+	// Window bounds the total time DownloadContinuous keeps sampling. A
+	// zero Window means "keep sampling until ctx is done".
+	Window time.Duration
+
+	// Format controls how samples are written out, both to the io.Writer
+	// and, when Rotate is set, to each rotated file. Without Rotate,
+	// multiple profile types require OutputFormatTar, since raw/gzip can
+	// only hold one profile type's stream.
+	Format OutputFormat
+
+	// Rotate, if set, writes every sample to its own file under Rotate.Dir
+	// instead of to the io.Writer passed to DownloadContinuous. It is
+	// incompatible with OutputFormatTar, which already produces one
+	// self-contained archive.
+	Rotate *RotationPolicy
+}
+
+// DownloadContinuous repeatedly captures the given profile types for the
+// duration of opts.Window (or until ctx is canceled, if Window is zero),
+// sampling every opts.Interval. Every profile type in pts is captured
+// concurrently within a single round, and written to out (or, with
+// opts.Rotate set, to individual files) according to opts.Format.
+//
+// Unlike Download, which performs a single point-in-time capture of one
+// profile type, DownloadContinuous lets SRE-style callers collect a time
+// series across one or more profile types from a pod without repeatedly
+// invoking Download by hand.
+func (d *Downloader) DownloadContinuous(ctx context.Context, pts []ProfileType, out io.Writer, opts ContinuousOptions) error {
+	if len(pts) == 0 {
+		return errors.New("DownloadContinuous requires at least one profile type")
+	}
+	for _, pt := range pts {
+		if pt < 0 || int(pt) >= len(ProfileEndpoints) {
+			return fmt.Errorf("unsupported profiling type %d", pt)
+		}
+	}
+	if opts.Interval <= 0 {
+		return errors.New("DownloadContinuous requires a positive Interval")
+	}
+	if opts.SampleDuration > 0 && opts.SampleDuration < time.Second {
+		for _, pt := range pts {
+			if isTimedProfile(pt) {
+				return fmt.Errorf("SampleDuration must be at least one second for CPU and trace profiles, got %s", opts.SampleDuration)
+			}
+		}
+	}
+	if opts.Interval < opts.SampleDuration {
+		return errors.New("Interval must be >= SampleDuration")
+	}
+	if opts.Rotate != nil && opts.Format == OutputFormatTar {
+		return errors.New("Rotate is incompatible with OutputFormatTar")
+	}
+	if len(pts) > 1 && opts.Rotate == nil && opts.Format != OutputFormatTar {
+		return errors.New("capturing more than one profile type requires OutputFormatTar or a RotationPolicy")
+	}
+
+	select {
+	case <-d.readyCh:
+	case <-d.stopCh:
+		return errors.New("download failed: stopped before port-forward was ready")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var tw *tar.Writer
+	if opts.Format == OutputFormatTar {
+		tw = tar.NewWriter(out)
+		defer tw.Close()
+	}
+	var rot *rotator
+	if opts.Rotate != nil {
+		rot = &rotator{dir: opts.Rotate.Dir, maxFiles: opts.Rotate.MaxFiles}
+	}
+
+	var stopAt <-chan time.Time
+	if opts.Window > 0 {
+		timer := time.NewTimer(opts.Window)
+		defer timer.Stop()
+		stopAt = timer.C
+	}
+
+	seq := 0
+	capture := func() error {
+		seq++
+		samples, err := d.captureAll(ctx, pts, opts.SampleDuration)
+		if err != nil {
+			return fmt.Errorf("continuous sample round %d failed: %v", seq, err)
+		}
+		for _, s := range samples {
+			if err := writeSample(out, tw, rot, s.pt, seq, s.data, opts.Format); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := capture(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.stopCh:
+			return errors.New("download failed: port-forward was stopped")
+		case <-stopAt:
+			return nil
+		case <-ticker.C:
+			if err := capture(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sample is one profile type's captured bytes within a capture round.
+type sample struct {
+	pt   ProfileType
+	data []byte
+}
+
+// captureAll captures every profile type in pts concurrently, returning
+// results in the same order as pts once every capture has completed.
+func (d *Downloader) captureAll(ctx context.Context, pts []ProfileType, sampleDuration time.Duration) ([]sample, error) {
+	samples := make([]sample, len(pts))
+	errs := make([]error, len(pts))
+
+	var wg sync.WaitGroup
+	wg.Add(len(pts))
+	for i, pt := range pts {
+		i, pt := i, pt
+		go func() {
+			defer wg.Done()
+			data, err := d.captureOne(ctx, pt, sampleDuration)
+			samples[i] = sample{pt: pt, data: data}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", profileTypeName(pts[i]), err)
+		}
+	}
+	return samples, nil
+}
+
+// captureOne performs a single HTTP capture of pt, appending pprof's
+// `seconds` query parameter when pt supports timed sampling.
+func (d *Downloader) captureOne(ctx context.Context, pt ProfileType, sampleDuration time.Duration) ([]byte, error) {
+	url := fmt.Sprintf("http://localhost:%d%s", d.localPort, ProfileEndpoints[pt])
+	if isTimedProfile(pt) && sampleDuration > 0 {
+		url = fmt.Sprintf("%s?seconds=%d", url, int(math.Round(sampleDuration.Seconds())))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download error: %s, code %d", body, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// rotator writes samples to individual files under dir, removing the
+// oldest ones once more than maxFiles have accumulated.
+type rotator struct {
+	dir      string
+	maxFiles int
+	files    []string
+}
+
+func (r *rotator) write(name string, data []byte) error {
+	path := filepath.Join(r.dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	r.files = append(r.files, path)
+	if r.maxFiles > 0 {
+		for len(r.files) > r.maxFiles {
+			os.Remove(r.files[0])
+			r.files = r.files[1:]
+		}
+	}
+	return nil
+}
+
+// writeSample serializes a single captured sample according to format,
+// writing it to rot (if set), tw (OutputFormatTar), or directly to out.
+func writeSample(out io.Writer, tw *tar.Writer, rot *rotator, pt ProfileType, seq int, data []byte, format OutputFormat) error {
+	if rot != nil {
+		encoded, ext, err := encodeSample(data, format)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%d%s", profileTypeName(pt), seq, ext)
+		return rot.write(name, encoded)
+	}
+
+	switch format {
+	case OutputFormatRaw:
+		_, err := out.Write(data)
+		return err
+	case OutputFormatGzip:
+		gw := gzip.NewWriter(out)
+		if _, err := gw.Write(data); err != nil {
+			return err
+		}
+		return gw.Close()
+	case OutputFormatTar:
+		gzipped, _, err := encodeSample(data, OutputFormatGzip)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s-%d.pb.gz", profileTypeName(pt), seq)
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(gzipped)),
+		}); err != nil {
+			return err
+		}
+		_, err = tw.Write(gzipped)
+		return err
+	default:
+		return fmt.Errorf("unsupported output format %d", format)
+	}
+}
+
+// encodeSample serializes data for format, returning the bytes to write
+// and the file extension that shape of data conventionally uses.
+func encodeSample(data []byte, format OutputFormat) ([]byte, string, error) {
+	switch format {
+	case OutputFormatRaw:
+		return data, ".pb", nil
+	case OutputFormatGzip:
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		if _, err := gw.Write(data); err != nil {
+			return nil, "", err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".pb.gz", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported output format %d", format)
+	}
+}
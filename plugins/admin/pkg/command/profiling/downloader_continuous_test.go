@@ -0,0 +1,198 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiling
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestDownloadContinuous(t *testing.T) {
+	newTestDownloader := func(t *testing.T, handler http.HandlerFunc) *Downloader {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		listenerAddr := server.Listener.Addr().String()
+		_, portString, err := net.SplitHostPort(listenerAddr)
+		assert.NilError(t, err)
+		port, err := strconv.ParseInt(portString, 10, 0)
+		assert.NilError(t, err)
+
+		d := &Downloader{
+			readyCh:   make(chan struct{}),
+			stopCh:    make(chan struct{}),
+			client:    http.DefaultClient,
+			localPort: uint32(port),
+		}
+		close(d.readyCh)
+		return d
+	}
+
+	t.Run("samples heap profile on every interval until the window elapses", func(t *testing.T) {
+		var mu sync.Mutex
+		var requests int
+		d := newTestDownloader(t, func(rw http.ResponseWriter, req *http.Request) {
+			assert.Equal(t, "/debug/pprof/heap", req.URL.Path)
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("sample"))
+		})
+
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeHeap}, output, ContinuousOptions{
+			Interval: 10 * time.Millisecond,
+			Window:   35 * time.Millisecond,
+			Format:   OutputFormatRaw,
+		})
+		assert.NilError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Assert(t, requests >= 3)
+	})
+
+	t.Run("appends seconds query parameter for timed profile types", func(t *testing.T) {
+		var gotQuery string
+		d := newTestDownloader(t, func(rw http.ResponseWriter, req *http.Request) {
+			gotQuery = req.URL.RawQuery
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("sample"))
+		})
+
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeCPU}, output, ContinuousOptions{
+			SampleDuration: 2 * time.Second,
+			Interval:       2 * time.Second,
+			Window:         1 * time.Millisecond,
+			Format:         OutputFormatRaw,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, "seconds=2", gotQuery)
+	})
+
+	t.Run("rejects a sub-second sample duration for timed profile types", func(t *testing.T) {
+		d := &Downloader{readyCh: make(chan struct{}), stopCh: make(chan struct{})}
+		close(d.readyCh)
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeCPU}, output, ContinuousOptions{
+			SampleDuration: 500 * time.Millisecond,
+			Interval:       time.Second,
+		})
+		assert.ErrorContains(t, err, "at least one second")
+	})
+
+	t.Run("rejects an interval shorter than the sample duration", func(t *testing.T) {
+		d := &Downloader{readyCh: make(chan struct{}), stopCh: make(chan struct{})}
+		close(d.readyCh)
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeCPU}, output, ContinuousOptions{
+			SampleDuration: 5 * time.Second,
+			Interval:       time.Second,
+		})
+		assert.ErrorContains(t, err, "Interval must be >= SampleDuration")
+	})
+
+	t.Run("unsupported profile type", func(t *testing.T) {
+		d := &Downloader{readyCh: make(chan struct{}), stopCh: make(chan struct{})}
+		close(d.readyCh)
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileType(len(ProfileEndpoints))}, output, ContinuousOptions{
+			Interval: time.Second,
+		})
+		assert.ErrorContains(t, err, "unsupported profiling type")
+	})
+
+	t.Run("rejects more than one profile type without tar or rotation", func(t *testing.T) {
+		d := &Downloader{readyCh: make(chan struct{}), stopCh: make(chan struct{})}
+		close(d.readyCh)
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeHeap, ProfileTypeGoroutine}, output, ContinuousOptions{
+			Interval: time.Second,
+			Format:   OutputFormatRaw,
+		})
+		assert.ErrorContains(t, err, "more than one profile type")
+	})
+
+	t.Run("captures multiple profile types concurrently into a tar bundle", func(t *testing.T) {
+		seen := map[string]bool{}
+		var mu sync.Mutex
+		d := newTestDownloader(t, func(rw http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			seen[req.URL.Path] = true
+			mu.Unlock()
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("sample-" + req.URL.Path))
+		})
+
+		output := &bytes.Buffer{}
+		err := d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeHeap, ProfileTypeGoroutine}, output, ContinuousOptions{
+			Interval: time.Second,
+			Window:   1 * time.Millisecond,
+			Format:   OutputFormatTar,
+		})
+		assert.NilError(t, err)
+
+		mu.Lock()
+		assert.Equal(t, 2, len(seen))
+		mu.Unlock()
+
+		tr := tar.NewReader(output)
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			names = append(names, hdr.Name)
+		}
+		assert.Equal(t, 2, len(names))
+	})
+
+	t.Run("rotates samples onto individual files on disk", func(t *testing.T) {
+		d := newTestDownloader(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("sample"))
+		})
+
+		dir, err := ioutil.TempDir("", "pprof-rotate")
+		assert.NilError(t, err)
+		defer os.RemoveAll(dir)
+
+		err = d.DownloadContinuous(context.Background(), []ProfileType{ProfileTypeHeap}, nil, ContinuousOptions{
+			Interval: 5 * time.Millisecond,
+			Window:   22 * time.Millisecond,
+			Format:   OutputFormatRaw,
+			Rotate:   &RotationPolicy{Dir: dir, MaxFiles: 2},
+		})
+		assert.NilError(t, err)
+
+		files, err := ioutil.ReadDir(dir)
+		assert.NilError(t, err)
+		assert.Assert(t, len(files) <= 2)
+	})
+}
@@ -0,0 +1,185 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/client-contrib/plugins/admin/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+var addPassword string
+var addPasswordStdin bool
+var addCredentialHelper string
+var identityToken string
+var addRegistryType string
+
+// NewRegistryAddCommand represents the add command
+func NewRegistryAddCommand(p *pkg.AdminParams) *cobra.Command {
+	var registryAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Add registry settings",
+		Long:  `Add registry settings by creating a secret and attaching it to a ServiceAccount`,
+		Example: `
+  # To add docker registry settings
+  kn admin registry add \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --password=[REGISTRY_PASSWORD]
+
+  # To add an OCI registry using a bearer identity token
+  kn admin registry add \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --identity-token=[IDENTITY_TOKEN] \
+    --registry-type=oci
+
+  # To add a Helm chart repository login
+  kn admin registry add \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --password=[REGISTRY_PASSWORD] \
+    --registry-type=helm`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if username == "" {
+				return errors.New("'registry add' requires the registry username provided with the --username option")
+			}
+			if server == "" {
+				return errors.New("'registry add' requires the registry server url provided with the --server option")
+			}
+			switch RegistryType(addRegistryType) {
+			case RegistryTypeDocker, RegistryTypeOCI, RegistryTypeHelm:
+			default:
+				return fmt.Errorf("'registry add' requires --registry-type to be one of docker, oci or helm, got %q", addRegistryType)
+			}
+			if addPassword == "" && !addPasswordStdin && addCredentialHelper == "" && identityToken == "" {
+				if helper, err := DetectCredentialHelper(server); err == nil && helper != "" {
+					addCredentialHelper = helper
+				}
+			}
+			if addPassword == "" && !addPasswordStdin && addCredentialHelper == "" && identityToken == "" {
+				return errors.New("'registry add' requires a credential provided with --password, --password-stdin, --credential-helper or --identity-token")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password := addPassword
+			if password == "" && identityToken == "" {
+				var err error
+				password, err = resolvePassword(cmd, addPassword, addPasswordStdin, addCredentialHelper)
+				if err != nil {
+					return err
+				}
+			}
+
+			client, err := p.NewKubeClient()
+			if err != nil {
+				return err
+			}
+
+			secret, err := newRegistrySecret(RegistryType(addRegistryType), server, username, password, identityToken)
+			if err != nil {
+				return err
+			}
+
+			created, err := client.CoreV1().Secrets(namespace).Create(secret)
+			if err != nil {
+				return fmt.Errorf("failed to create secret: %v", err)
+			}
+			cmd.Printf("Secret '%s/%s' created\n", created.Namespace, created.Name)
+
+			if RegistryType(addRegistryType) == RegistryTypeHelm {
+				// Helm repository credentials aren't consumed via ImagePullSecrets,
+				// so there is no ServiceAccount to update.
+				return nil
+			}
+
+			sa, err := client.CoreV1().ServiceAccounts(namespace).Get(serviceAccount, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get ServiceAccount: %v", err)
+			}
+			desiredSa := sa.DeepCopy()
+			desiredSa.ImagePullSecrets = append(desiredSa.ImagePullSecrets, corev1.LocalObjectReference{Name: created.Name})
+			if _, err := client.CoreV1().ServiceAccounts(namespace).Update(desiredSa); err != nil {
+				return fmt.Errorf("failed to attach registry secret to ServiceAccount: %v", err)
+			}
+			cmd.Printf("ImagePullSecrets of ServiceAccount '%s/%s' updated\n", desiredSa.Namespace, desiredSa.Name)
+			return nil
+		},
+	}
+
+	registryAddCmd.Flags().StringVar(&username, "username", "", "Registry Username")
+	registryAddCmd.MarkFlagRequired("username")
+	registryAddCmd.Flags().StringVar(&server, "server", "", "Registry Address")
+	registryAddCmd.MarkFlagRequired("server")
+	registryAddCmd.Flags().StringVar(&addPassword, "password", "", "Registry Password")
+	registryAddCmd.Flags().BoolVar(&addPasswordStdin, "password-stdin", false, "Take the registry password from stdin")
+	registryAddCmd.Flags().StringVar(&addCredentialHelper, "credential-helper", "", "Docker credential helper to source the password from (e.g. osxkeychain, secretservice, wincred, pass); auto-detected from ~/.docker/config.json when unset")
+	registryAddCmd.Flags().StringVar(&identityToken, "identity-token", "", "OCI bearer identity token, stored alongside auth instead of a long-lived password (--registry-type=oci)")
+	registryAddCmd.Flags().StringVar(&addRegistryType, "registry-type", string(RegistryTypeDocker), "Shape of the secret to create: docker, oci or helm")
+	registryAddCmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace to create the registry secret in")
+	registryAddCmd.Flags().StringVar(&serviceAccount, "serviceaccount", "default", "ServiceAccount to attach the registry secret to")
+	registryAddCmd.InitDefaultHelpFlag()
+	return registryAddCmd
+}
+
+// newRegistrySecret builds the Kubernetes secret for registryType, matching
+// the layout list/update/remove already know how to read back.
+func newRegistrySecret(registryType RegistryType, server, username, password, identityToken string) (*corev1.Secret, error) {
+	meta := metav1.ObjectMeta{
+		GenerateName: "kn-admin-registry-",
+		Labels:       AdminRegistryLabels,
+	}
+
+	if registryType == RegistryTypeHelm {
+		meta.Annotations = map[string]string{ServerAnnotation: server}
+		return &corev1.Secret{
+			ObjectMeta: meta,
+			Type:       corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				HelmUsernameKey: []byte(username),
+				HelmPasswordKey: []byte(password),
+			},
+		}, nil
+	}
+
+	auth := Auth{
+		Username: username,
+		Password: password,
+		Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	}
+	if registryType == RegistryTypeOCI {
+		auth.IdentityToken = identityToken
+	}
+
+	registry := Registry{Auths: map[string]Auth{server: auth}}
+	data, err := json.Marshal(registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registry secret data: %v", err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: meta,
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{DockerJSONName: data},
+	}, nil
+}
@@ -0,0 +1,103 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package registry's credential helper support backs both `registry add`
+// and `registry update`: add sources the initial password for a new secret
+// from it, update sources the rotated one.
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dockerConfig is the subset of ~/.docker/config.json this package reads to
+// auto-detect which docker-credential-helpers binary to use for a server.
+type dockerConfig struct {
+	CredsStore  string            `json:"credsStore,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// credentialHelperResult is the JSON shape a docker-credential-<name> helper
+// writes to stdout in response to a `get` request, per the protocol
+// documented at github.com/docker/docker-credential-helpers.
+type credentialHelperResult struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// DetectCredentialHelper returns the docker-credential-helpers binary name
+// (without the "docker-credential-" prefix) that the user's
+// ~/.docker/config.json configures for server, falling back to the global
+// credsStore, or "" if neither is configured.
+func DetectCredentialHelper(server string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve home directory: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".docker", "config.json"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read docker config: %v", err)
+	}
+
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse docker config: %v", err)
+	}
+	if helper, ok := cfg.CredHelpers[server]; ok {
+		return helper, nil
+	}
+	return cfg.CredsStore, nil
+}
+
+// CredentialFromHelper shells out to docker-credential-<helper> to fetch
+// the username/password pair stored for server, following the helper's
+// documented stdin/stdout JSON protocol: the server URL is written to the
+// helper's stdin for a "get" request, and it responds on stdout with
+// {"ServerURL":..., "Username":..., "Secret":...}.
+func CredentialFromHelper(helper, server string) (username, password string, err error) {
+	if helper == "" {
+		return "", "", fmt.Errorf("no credential helper configured")
+	}
+
+	binary := "docker-credential-" + helper
+	if _, err := exec.LookPath(binary); err != nil {
+		return "", "", fmt.Errorf("credential helper %q not found on PATH: %v", binary, err)
+	}
+
+	cmd := exec.Command(binary, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("%s get failed: %v: %s", binary, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var result credentialHelperResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return "", "", fmt.Errorf("failed to parse %s output: %v", binary, err)
+	}
+	return result.Username, result.Secret, nil
+}
@@ -0,0 +1,97 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/client-contrib/plugins/admin/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// NewRegistryListCommand represents the list command
+func NewRegistryListCommand(p *pkg.AdminParams) *cobra.Command {
+	var registryListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List registry settings",
+		Long:  `List the server and username of every registry secret managed by kn-admin-registry, and whether it is attached to --serviceaccount`,
+		Example: `
+  # To list registry settings
+  kn admin registry list
+
+  # To list registry settings for a non-default namespace and ServiceAccount
+  kn admin registry list --namespace=[NAMESPACE] --serviceaccount=[SERVICE_ACCOUNT]`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := p.NewKubeClient()
+			if err != nil {
+				return err
+			}
+
+			secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(AdminRegistryLabels).String(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list secret: %v", err)
+			}
+
+			attached := map[string]bool{}
+			sa, err := client.CoreV1().ServiceAccounts(namespace).Get(serviceAccount, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to get ServiceAccount: %v", err)
+			}
+			if sa != nil {
+				for _, ips := range sa.ImagePullSecrets {
+					attached[ips.Name] = true
+				}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 3, ' ', 0)
+			fmt.Fprintln(w, "SECRET\tTYPE\tSERVER\tUSERNAME\tATTACHED")
+			for _, secret := range secrets.Items {
+				if secret.Type == corev1.SecretTypeOpaque {
+					// RegistryTypeHelm: username/password keys, server kept in an
+					// annotation; Helm repo credentials aren't ImagePullSecrets.
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\tn/a\n", secret.Name, RegistryTypeHelm, secret.Annotations[ServerAnnotation], secret.Data[HelmUsernameKey])
+					continue
+				}
+
+				registry := Registry{}
+				if err := json.Unmarshal(secret.Data[DockerJSONName], &registry); err != nil {
+					return fmt.Errorf("failed unmarshal secret data '.dockerconfigjson': %v", err)
+				}
+				for server, auth := range registry.Auths {
+					registryType := RegistryTypeDocker
+					if auth.IdentityToken != "" {
+						registryType = RegistryTypeOCI
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\n", secret.Name, registryType, server, auth.Username, attached[secret.Name])
+				}
+			}
+			return w.Flush()
+		},
+	}
+
+	registryListCmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace to list registry secrets from")
+	registryListCmd.Flags().StringVar(&serviceAccount, "serviceaccount", "default", "ServiceAccount to check registry secrets against for the ATTACHED column")
+	registryListCmd.InitDefaultHelpFlag()
+	return registryListCmd
+}
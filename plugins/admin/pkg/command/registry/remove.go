@@ -32,6 +32,8 @@ import (
 
 var username string
 var server string
+var namespace string
+var serviceAccount string
 
 // NewRegistryRmCommand represents the remove command
 func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
@@ -44,7 +46,14 @@ func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
   # To remove registry settings
   kn admin registry remove \
     --username=[REGISTRY_USER] \
-    --server=[REGISTRY_SERVER_URL]`,
+    --server=[REGISTRY_SERVER_URL]
+
+  # To remove registry settings for a non-default namespace and ServiceAccount
+  kn admin registry remove \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --namespace=[NAMESPACE] \
+    --serviceaccount=[SERVICE_ACCOUNT]`,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			if username == "" {
 				return errors.New("'registry remove' requires the registry username provided with the --username option")
@@ -61,16 +70,26 @@ func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
 			}
 
 			// get all credential secrets which have the label managed-by=kn-admin-registry
-			secrets, err := client.CoreV1().Secrets("default").List(metav1.ListOptions{
+			secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{
 				LabelSelector: labels.SelectorFromSet(AdminRegistryLabels).String(),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to list secret: %v", err)
 			}
 
-			// filter the secrets with username and server
+			// filter the secrets with username and server, matching whichever
+			// of the docker/oci or helm secret layouts the secret was stored in
 			secretsMap := make(map[string]*corev1.Secret)
 			for _, secret := range secrets.Items {
+				secret := secret
+				if secret.Type == corev1.SecretTypeOpaque {
+					// RegistryTypeHelm: username/password keys, server kept in an annotation
+					if secret.Annotations[ServerAnnotation] == server && string(secret.Data[HelmUsernameKey]) == username {
+						secretsMap[secret.Name] = &secret
+					}
+					continue
+				}
+
 				registry := Registry{}
 				err = json.Unmarshal(secret.Data[DockerJSONName], &registry)
 				if err != nil {
@@ -87,7 +106,7 @@ func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
 				return nil
 			}
 
-			defaultSa, err := client.CoreV1().ServiceAccounts("default").Get("default", metav1.GetOptions{})
+			defaultSa, err := client.CoreV1().ServiceAccounts(namespace).Get(serviceAccount, metav1.GetOptions{})
 			if err != nil {
 				return fmt.Errorf("failed to get ServiceAccount: %v", err)
 			}
@@ -103,7 +122,7 @@ func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
 			}
 
 			desiredSa.ImagePullSecrets = imagePullSecrets
-			_, err = client.CoreV1().ServiceAccounts("default").Update(desiredSa)
+			_, err = client.CoreV1().ServiceAccounts(namespace).Update(desiredSa)
 			if err != nil {
 				return fmt.Errorf("failed to remove registry secret in default ServiceAccount: %v", err)
 			}
@@ -133,6 +152,8 @@ func NewRegistryRmCommand(p *pkg.AdminParams) *cobra.Command {
 	registryRmCmd.MarkFlagRequired("username")
 	registryRmCmd.Flags().StringVar(&server, "server", "", "Registry Address")
 	registryRmCmd.MarkFlagRequired("server")
+	registryRmCmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace of the ServiceAccount to update")
+	registryRmCmd.Flags().StringVar(&serviceAccount, "serviceaccount", "default", "ServiceAccount to remove the registry secret from")
 	registryRmCmd.InitDefaultHelpFlag()
 	return registryRmCmd
 }
@@ -0,0 +1,73 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DockerJSONName is the secret data key docker and oci registry
+	// secrets store their `.dockerconfigjson` document under.
+	DockerJSONName = corev1.DockerConfigJsonKey
+
+	// HelmUsernameKey and HelmPasswordKey are the data keys written into
+	// the Opaque secret produced for --registry-type=helm, matching what
+	// `helm registry login`-style consumers expect.
+	HelmUsernameKey = "username"
+	HelmPasswordKey = "password"
+)
+
+// AdminRegistryLabels marks every secret created by kn-admin registry so
+// list/update/remove can find it again regardless of --registry-type.
+var AdminRegistryLabels = map[string]string{"managed-by": "kn-admin-registry"}
+
+// ServerAnnotation records the registry server a RegistryTypeHelm secret
+// was created for, since (unlike the docker/oci `.dockerconfigjson` shape)
+// an Opaque username/password secret has nowhere else to carry it.
+const ServerAnnotation = "kn-admin-registry.knative.dev/server"
+
+// RegistryType selects the shape of secret the registry commands produce.
+type RegistryType string
+
+const (
+	// RegistryTypeDocker is the classic `.dockerconfigjson` secret with a
+	// single auths[server]{username,password,auth} entry.
+	RegistryTypeDocker RegistryType = "docker"
+	// RegistryTypeOCI is a `.dockerconfigjson` secret whose entry may also
+	// carry an identitytoken for bearer-token exchange.
+	RegistryTypeOCI RegistryType = "oci"
+	// RegistryTypeHelm is an Opaque secret with username/password keys,
+	// for Helm chart repositories used by Knative serving builds.
+	RegistryTypeHelm RegistryType = "helm"
+)
+
+// Registry is the `.dockerconfigjson` document stored under DockerJSONName
+// in a docker or oci registry secret's data.
+type Registry struct {
+	Auths map[string]Auth `json:"auths"`
+}
+
+// Auth holds the credentials for a single server entry in Registry.Auths.
+//
+// IdentityToken is populated instead of Password for OCI registries that
+// authenticate via bearer-token exchange, mirroring the `identitytoken`
+// field the Docker CLI writes for the same flow.
+type Auth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
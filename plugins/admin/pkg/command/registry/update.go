@@ -0,0 +1,196 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"knative.dev/client-contrib/plugins/admin/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+var newPassword string
+var newPasswordStdin bool
+var credentialHelper string
+
+// NewRegistryUpdateCommand represents the update command
+func NewRegistryUpdateCommand(p *pkg.AdminParams) *cobra.Command {
+	var registryUpdateCmd = &cobra.Command{
+		Use:   "update",
+		Short: "Update registry settings",
+		Long:  `Rotate the password for an existing registry secret in place, without touching the ServiceAccount`,
+		Example: `
+  # To rotate the password for a registry
+  kn admin registry update \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --password=[NEW_PASSWORD]
+
+  # To pull the new password from a Docker credential helper instead
+  kn admin registry update \
+    --username=[REGISTRY_USER] \
+    --server=[REGISTRY_SERVER_URL] \
+    --credential-helper=osxkeychain`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if username == "" {
+				return errors.New("'registry update' requires the registry username provided with the --username option")
+			}
+			if server == "" {
+				return errors.New("'registry update' requires the registry server url provided with the --server option")
+			}
+			if newPassword == "" && !newPasswordStdin && credentialHelper == "" {
+				if helper, err := DetectCredentialHelper(server); err == nil && helper != "" {
+					credentialHelper = helper
+				}
+			}
+			if newPassword == "" && !newPasswordStdin && credentialHelper == "" {
+				return errors.New("'registry update' requires the new password provided with --password, --password-stdin, or --credential-helper")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := resolvePassword(cmd, newPassword, newPasswordStdin, credentialHelper)
+			if err != nil {
+				return err
+			}
+
+			client, err := p.NewKubeClient()
+			if err != nil {
+				return err
+			}
+
+			secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(AdminRegistryLabels).String(),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to list secret: %v", err)
+			}
+
+			var target *corev1.Secret
+			var registry Registry
+			var isHelm bool
+			for i := range secrets.Items {
+				secret := &secrets.Items[i]
+				if secret.Type == corev1.SecretTypeOpaque {
+					// RegistryTypeHelm: server lives in an annotation, username in
+					// the Opaque data, since there's no `.dockerconfigjson` here.
+					if secret.Annotations[ServerAnnotation] == server && string(secret.Data[HelmUsernameKey]) == username {
+						target = secret
+						isHelm = true
+						break
+					}
+					continue
+				}
+				reg := Registry{}
+				if err := json.Unmarshal(secret.Data[DockerJSONName], &reg); err != nil {
+					return fmt.Errorf("failed unmarshal secret data '.dockerconfigjson': %v", err)
+				}
+				if auth, ok := reg.Auths[server]; ok && auth.Username == username {
+					target = secret
+					registry = reg
+					break
+				}
+			}
+			if target == nil {
+				return fmt.Errorf("no registry found for server: '%s' and username: '%s'", server, username)
+			}
+
+			sa, err := client.CoreV1().ServiceAccounts(namespace).Get(serviceAccount, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("failed to get ServiceAccount: %v", err)
+			}
+			attached := false
+			for _, ips := range sa.ImagePullSecrets {
+				if ips.Name == target.Name {
+					attached = true
+					break
+				}
+			}
+			if !attached {
+				// A secret's password validity doesn't depend on which
+				// ServiceAccount references it, so this is advisory only:
+				// rotating a secret attached to a different SA, or none at
+				// all, is a legitimate use of --serviceaccount's default.
+				cmd.Printf("Warning: secret '%s/%s' is not referenced by ServiceAccount '%s'\n", namespace, target.Name, serviceAccount)
+			}
+
+			if isHelm {
+				target.Data[HelmPasswordKey] = []byte(password)
+			} else {
+				auth := registry.Auths[server]
+				auth.Password = password
+				auth.Auth = base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+				registry.Auths[server] = auth
+
+				data, err := json.Marshal(registry)
+				if err != nil {
+					return fmt.Errorf("failed to marshal registry secret data: %v", err)
+				}
+				target.Data[DockerJSONName] = data
+			}
+
+			if _, err := client.CoreV1().Secrets(namespace).Update(target); err != nil {
+				return fmt.Errorf("failed to update secret '%s/%s': %v", namespace, target.Name, err)
+			}
+			cmd.Printf("Secret '%s/%s' updated\n", namespace, target.Name)
+			return nil
+		},
+	}
+
+	registryUpdateCmd.Flags().StringVar(&username, "username", "", "Registry Username")
+	registryUpdateCmd.MarkFlagRequired("username")
+	registryUpdateCmd.Flags().StringVar(&server, "server", "", "Registry Address")
+	registryUpdateCmd.MarkFlagRequired("server")
+	registryUpdateCmd.Flags().StringVar(&newPassword, "password", "", "New registry password")
+	registryUpdateCmd.Flags().BoolVar(&newPasswordStdin, "password-stdin", false, "Take the new registry password from stdin")
+	registryUpdateCmd.Flags().StringVar(&credentialHelper, "credential-helper", "", "Docker credential helper to source the new password from (e.g. osxkeychain, secretservice, wincred, pass); auto-detected from ~/.docker/config.json when unset")
+	registryUpdateCmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace the registry secret lives in")
+	registryUpdateCmd.Flags().StringVar(&serviceAccount, "serviceaccount", "default", "ServiceAccount expected to reference the registry secret")
+	registryUpdateCmd.InitDefaultHelpFlag()
+	return registryUpdateCmd
+}
+
+// resolvePassword returns flagValue if it was set, reads a single line from
+// the command's stdin when fromStdin is true, or otherwise queries helper
+// via the docker-credential-helpers protocol.
+func resolvePassword(cmd *cobra.Command, flagValue string, fromStdin bool, helper string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if fromStdin {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", fmt.Errorf("failed to read password from stdin: %v", err)
+			}
+			return "", errors.New("no password provided on stdin")
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+	_, password, err := CredentialFromHelper(helper, server)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from credential helper: %v", err)
+	}
+	return password, nil
+}